@@ -2,10 +2,11 @@ package account
 
 import (
 	"errors"
-	"github.com/pborman/uuid"
-	"go-vite/common"
-	"go-vite/crypto/ed25519"
 	"strconv"
+
+	"github.com/pborman/uuid"
+	"github.com/vitelabs/go-vite/common"
+	"github.com/vitelabs/go-vite/crypto/ed25519"
 )
 
 const (
@@ -0,0 +1,261 @@
+package account
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"github.com/vitelabs/go-vite/common"
+	"github.com/vitelabs/go-vite/crypto/ed25519"
+	"github.com/vitelabs/go-vite/wallet/walleterrors"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	cipherName = "xsalsa20poly1305"
+	kdfName    = "scrypt"
+
+	scryptR           = 8
+	scryptP           = 1
+	scryptDKLen       = 32
+	scryptSaltLen     = 32
+	secretboxNonceLen = 24
+
+	// StandardScryptN is the scrypt cost parameter used for real keystore
+	// files.
+	StandardScryptN = 1 << 18 // 262144
+
+	// LightScryptN is a much cheaper scrypt cost parameter, meant only for
+	// tests: it makes keystore round trips fast instead of taking seconds.
+	LightScryptN = 1 << 12 // 4096
+)
+
+// KDFParams are the scrypt parameters a given keystore file was encrypted
+// with; they are read back from the file on ExtractKey so files created
+// with different cost settings (e.g. light vs standard) all decrypt the
+// same way.
+type KDFParams struct {
+	N      int
+	R      int
+	P      int
+	KeyLen int
+	Salt   []byte
+}
+
+// scryptKeyStore implements keyStore on top of scrypt + xsalsa20poly1305
+// (nacl/secretbox), writing one UTC--<timestamp>--<address> JSON file per
+// key under keysDirPath, go-ethereum-keystore style.
+type scryptKeyStore struct {
+	keysDirPath string
+	scryptN     int
+	scryptP     int
+}
+
+// NewKeyStore returns a keyStore that encrypts with the standard (slow,
+// production) scrypt cost parameters.
+func NewKeyStore(keysDirPath string) keyStore {
+	return &scryptKeyStore{keysDirPath: keysDirPath, scryptN: StandardScryptN, scryptP: scryptP}
+}
+
+// NewLightKeyStore returns a keyStore using the light scrypt profile, so
+// tests that store/extract keys don't pay the full KDF cost.
+func NewLightKeyStore(keysDirPath string) keyStore {
+	return &scryptKeyStore{keysDirPath: keysDirPath, scryptN: LightScryptN, scryptP: scryptP}
+}
+
+func (ks *scryptKeyStore) StoreKey(k *Key, password string) error {
+	salt := make([]byte, scryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	derivedKey, err := scrypt.Key([]byte(password), salt, ks.scryptN, scryptR, ks.scryptP, scryptDKLen)
+	if err != nil {
+		return err
+	}
+	var secretboxKey [32]byte
+	copy(secretboxKey[:], derivedKey)
+
+	var nonce [secretboxNonceLen]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+
+	cipherText := secretbox.Seal(nil, (*k.PrivateKey)[:], &nonce, &secretboxKey)
+
+	cryptoStruct := cryptoJSON{
+		Cipher:     cipherName,
+		CipherText: hex.EncodeToString(cipherText),
+		Nonce:      hex.EncodeToString(nonce[:]),
+		KDF:        kdfName,
+		KDFParams: map[string]interface{}{
+			"n":      ks.scryptN,
+			"r":      scryptR,
+			"p":      ks.scryptP,
+			"keylen": scryptDKLen,
+			"salt":   hex.EncodeToString(salt),
+		},
+	}
+	encJSON := encryptedKeyJSON{
+		Address: common.BytesToAddress(k.Address.Bytes()).Hex(),
+		Crypto:  cryptoStruct,
+		Id:      k.Id.String(),
+		Version: version,
+	}
+
+	data, err := json.MarshalIndent(encJSON, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(ks.keysDirPath, 0700); err != nil {
+		return err
+	}
+	return writeKeyFile(ks.keyFilePath(k.Address), data)
+}
+
+func (ks *scryptKeyStore) ExtractKey(address common.Address, password string) (*Key, error) {
+	path, err := ks.findKeyFile(address)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	encJSON := new(encryptedKeyJSON)
+	if err := json.Unmarshal(data, encJSON); err != nil {
+		return nil, err
+	}
+	if encJSON.Version != version {
+		return migrateKeyJSON(encJSON, password)
+	}
+
+	params, err := parseKDFParams(encJSON.Crypto.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	if encJSON.Crypto.KDF != kdfName {
+		return nil, fmt.Errorf("account: unsupported KDF %q", encJSON.Crypto.KDF)
+	}
+
+	derivedKey, err := scrypt.Key([]byte(password), params.Salt, params.N, params.R, params.P, params.KeyLen)
+	if err != nil {
+		return nil, err
+	}
+	var secretboxKey [32]byte
+	copy(secretboxKey[:], derivedKey)
+
+	nonce, err := hex.DecodeString(encJSON.Crypto.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != secretboxNonceLen {
+		return nil, errors.New("account: invalid nonce length")
+	}
+	var nonceArr [secretboxNonceLen]byte
+	copy(nonceArr[:], nonce)
+
+	cipherText, err := hex.DecodeString(encJSON.Crypto.CipherText)
+	if err != nil {
+		return nil, err
+	}
+
+	plainText, ok := secretbox.Open(nil, cipherText, &nonceArr, &secretboxKey)
+	if !ok {
+		// Wrong password and corrupt ciphertext are indistinguishable to
+		// secretbox, so both map to the same sentinel error.
+		return nil, walleterrors.ErrDecryptKey
+	}
+	if len(plainText) != ed25519.PrivateKeySize {
+		return nil, walleterrors.ErrDecryptKey
+	}
+
+	var priv ed25519.PrivateKey = make([]byte, ed25519.PrivateKeySize)
+	copy(priv, plainText)
+
+	id := uuid.Parse(encJSON.Id)
+	if id == nil {
+		return nil, fmt.Errorf("account: invalid key id %q", encJSON.Id)
+	}
+
+	return &Key{
+		Id:         id,
+		Address:    address,
+		PrivateKey: &priv,
+	}, nil
+}
+
+// migrateKeyJSON handles keystore files written by a future/older version.
+// There is only version 1 today, so this is a hook for when version is
+// bumped rather than a working migration.
+func migrateKeyJSON(encJSON *encryptedKeyJSON, password string) (*Key, error) {
+	return nil, fmt.Errorf("account: unsupported keystore version %d", encJSON.Version)
+}
+
+func parseKDFParams(raw map[string]interface{}) (*KDFParams, error) {
+	asInt := func(v interface{}) (int, bool) {
+		switch n := v.(type) {
+		case float64:
+			return int(n), true
+		case int:
+			return n, true
+		}
+		return 0, false
+	}
+
+	n, ok1 := asInt(raw["n"])
+	r, ok2 := asInt(raw["r"])
+	p, ok3 := asInt(raw["p"])
+	keyLen, ok4 := asInt(raw["keylen"])
+	saltHex, ok5 := raw["salt"].(string)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 {
+		return nil, errors.New("account: malformed scrypt kdfparams")
+	}
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return nil, err
+	}
+	return &KDFParams{N: n, R: r, P: p, KeyLen: keyLen, Salt: salt}, nil
+}
+
+func (ks *scryptKeyStore) keyFilePath(address common.Address) string {
+	ts := time.Now().UTC()
+	fileName := fmt.Sprintf("UTC--%s--%s", ts.Format("2006-01-02T15-04-05.000000000Z"), address.Hex())
+	return filepath.Join(ks.keysDirPath, fileName)
+}
+
+func (ks *scryptKeyStore) findKeyFile(address common.Address) (string, error) {
+	entries, err := ioutil.ReadDir(ks.keysDirPath)
+	if err != nil {
+		return "", err
+	}
+	suffix := strings.ToLower(address.Hex())
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(strings.ToLower(e.Name()), suffix) {
+			return filepath.Join(ks.keysDirPath, e.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("account: no key file found for address %s", address.Hex())
+}
+
+func writeKeyFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
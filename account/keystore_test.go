@@ -0,0 +1,69 @@
+package account
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pborman/uuid"
+	"github.com/vitelabs/go-vite/common"
+	"github.com/vitelabs/go-vite/crypto/ed25519"
+	"github.com/vitelabs/go-vite/wallet/walleterrors"
+)
+
+func newTestKey(t *testing.T) *Key {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	var addr common.Address
+	copy(addr[:], priv[ed25519.PrivateKeySize-len(addr):])
+	return &Key{Id: uuid.NewRandom(), Address: addr, PrivateKey: &priv}
+}
+
+func TestStoreAndExtractKeyRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vite-keystore-test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := NewLightKeyStore(dir)
+	k := newTestKey(t)
+
+	if err := ks.StoreKey(k, "correct horse battery staple"); err != nil {
+		t.Fatalf("StoreKey: %v", err)
+	}
+
+	got, err := ks.ExtractKey(k.Address, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("ExtractKey: %v", err)
+	}
+	if got.Address != k.Address {
+		t.Fatalf("address mismatch: got %x, want %x", got.Address, k.Address)
+	}
+	if string(*got.PrivateKey) != string(*k.PrivateKey) {
+		t.Fatalf("private key mismatch after round trip")
+	}
+}
+
+func TestExtractKeyWrongPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-vite-keystore-test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := NewLightKeyStore(dir)
+	k := newTestKey(t)
+	if err := ks.StoreKey(k, "right password"); err != nil {
+		t.Fatalf("StoreKey: %v", err)
+	}
+
+	_, err = ks.ExtractKey(k.Address, "wrong password")
+	if err != walleterrors.ErrDecryptKey {
+		t.Fatalf("expected ErrDecryptKey, got %v", err)
+	}
+}
@@ -0,0 +1,498 @@
+// Package rlp implements a minimal, canonical RLP (Recursive Length Prefix)
+// codec used to put p2p wire messages and ledger structures on disk/wire in
+// a deterministic, hashable form.
+//
+// A struct's field layout is derived once per type via reflection (see
+// cachedTypeInfo) and reused by the generic struct encoder/decoder, so that
+// callers only need to add struct tags instead of hand rolling per-field
+// Serialize/Deserialize code:
+//
+//	type Foo struct {
+//		Name string
+//		Age  uint64 `rlp:"optional"`
+//		Rest []byte `rlp:"tail"`
+//	}
+//
+// `optional` fields must be a contiguous suffix of the struct and are
+// omitted from the wire form when they, and every optional field after
+// them, hold the zero value. `tail` marks a
+// single trailing slice field that absorbs any remaining list elements
+// instead of being nested as its own list.
+//
+// Types may also implement Encoder/Decoder directly to take full control of
+// their own wire format (this is how ledger.SnapshotBlock/ledger.AccountBlock
+// are expected to plug in once they grow their own rlp rules).
+package rlp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// Encoder is implemented by types that know how to encode themselves to RLP.
+type Encoder interface {
+	EncodeRLP() ([]byte, error)
+}
+
+// Decoder is implemented by types that know how to decode themselves from RLP.
+type Decoder interface {
+	DecodeRLP([]byte) error
+}
+
+var (
+	// ErrNonCanonicalSize is returned when decoding a fixed-size byte array
+	// (e.g. an address or hash) whose encoded length does not match.
+	ErrNonCanonicalSize = errors.New("rlp: non-canonical size for fixed-length field")
+	// ErrNonCanonicalInt is returned when a big integer / uint is encoded
+	// with a leading zero byte.
+	ErrNonCanonicalInt = errors.New("rlp: non-canonical integer (leading zero byte)")
+	// ErrExtraData is returned when the input contains trailing bytes after
+	// the value has been fully decoded.
+	ErrExtraData = errors.New("rlp: extra data after decoded value")
+	ErrTooShort  = errors.New("rlp: value too short")
+)
+
+// EncodeToBytes returns the canonical RLP encoding of val.
+func EncodeToBytes(val interface{}) ([]byte, error) {
+	return encode(reflect.ValueOf(val))
+}
+
+// DecodeBytes parses the canonical RLP encoding of buf into val, which must
+// be a non-nil pointer. It returns ErrExtraData if buf contains more than
+// one value.
+func DecodeBytes(buf []byte, val interface{}) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("rlp: DecodeBytes requires a non-nil pointer")
+	}
+	content, rest, err := splitItem(buf)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return ErrExtraData
+	}
+	return decode(content, rv.Elem())
+}
+
+// ---------------------------------------------------------------------------
+// encoding
+// ---------------------------------------------------------------------------
+
+func encode(v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return wrapString(nil), nil
+	}
+
+	if v.CanInterface() {
+		if enc, ok := v.Interface().(Encoder); ok {
+			return enc.EncodeRLP()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return wrapString(nil), nil
+		}
+		return encode(v.Elem())
+
+	case reflect.Struct:
+		if v.Type() == bigIntType {
+			return encodeBigInt(v.Addr().Interface().(*big.Int)), nil
+		}
+		return encodeStruct(v)
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return wrapString(bytesOf(v)), nil
+		}
+		items := make([][]byte, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := encode(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return wrapList(items), nil
+
+	case reflect.String:
+		return wrapString([]byte(v.String())), nil
+
+	case reflect.Bool:
+		if v.Bool() {
+			return wrapString([]byte{1}), nil
+		}
+		return wrapString([]byte{0}), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return wrapString(minimalBigEndian(v.Uint())), nil
+
+	case reflect.Interface:
+		if v.IsNil() {
+			return wrapString(nil), nil
+		}
+		return encode(v.Elem())
+	}
+
+	return nil, fmt.Errorf("rlp: unsupported type %v", v.Type())
+}
+
+func encodeStruct(v reflect.Value) ([]byte, error) {
+	fields := cachedTypeInfo(v.Type())
+	items := make([][]byte, 0, len(fields))
+
+	// trailing optional fields may be dropped if they (and everything after
+	// them) hold the zero value.
+	lastNonZero := -1
+	for i, f := range fields {
+		if !f.optional {
+			lastNonZero = i
+			continue
+		}
+		if !v.Field(f.index).IsZero() {
+			lastNonZero = i
+		}
+	}
+
+	for i, f := range fields {
+		if f.optional && i > lastNonZero {
+			continue
+		}
+		fv := v.Field(f.index)
+		if f.tail {
+			for j := 0; j < fv.Len(); j++ {
+				item, err := encode(fv.Index(j))
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			continue
+		}
+		item, err := encode(fv)
+		if err != nil {
+			return nil, fmt.Errorf("rlp: field %s: %w", f.name, err)
+		}
+		items = append(items, item)
+	}
+	return wrapList(items), nil
+}
+
+func encodeBigInt(i *big.Int) []byte {
+	if i == nil || i.Sign() == 0 {
+		return wrapString(nil)
+	}
+	return wrapString(i.Bytes())
+}
+
+// ---------------------------------------------------------------------------
+// decoding
+// ---------------------------------------------------------------------------
+
+func decode(content []byte, v reflect.Value) error {
+	if v.CanAddr() {
+		if dec, ok := v.Addr().Interface().(Decoder); ok {
+			return dec.DecodeRLP(content)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := decode(content, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+
+	case reflect.Struct:
+		if v.Type() == bigIntType {
+			return decodeBigInt(content, v.Addr().Interface().(*big.Int))
+		}
+		return decodeStruct(content, v)
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return decodeBytes(content, v)
+		}
+		return decodeList(content, v)
+
+	case reflect.String:
+		v.SetString(string(content))
+		return nil
+
+	case reflect.Bool:
+		if len(content) != 1 || content[0] > 1 {
+			return fmt.Errorf("rlp: invalid bool encoding")
+		}
+		v.SetBool(content[0] == 1)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := decodeUint(content)
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+		return nil
+	}
+
+	return fmt.Errorf("rlp: unsupported type %v", v.Type())
+}
+
+func decodeStruct(content []byte, v reflect.Value) error {
+	fields := cachedTypeInfo(v.Type())
+	rest := content
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		if f.tail {
+			for len(rest) > 0 {
+				elem := reflect.New(fv.Type().Elem()).Elem()
+				itemContent, r, err := splitItem(rest)
+				if err != nil {
+					return err
+				}
+				if err := decode(itemContent, elem); err != nil {
+					return err
+				}
+				fv.Set(reflect.Append(fv, elem))
+				rest = r
+			}
+			continue
+		}
+		if len(rest) == 0 {
+			if f.optional {
+				continue
+			}
+			return fmt.Errorf("rlp: missing required field %s", f.name)
+		}
+		itemContent, r, err := splitItem(rest)
+		if err != nil {
+			return err
+		}
+		if err := decode(itemContent, fv); err != nil {
+			return err
+		}
+		rest = r
+	}
+	if len(rest) != 0 {
+		return ErrExtraData
+	}
+	return nil
+}
+
+func decodeList(content []byte, v reflect.Value) error {
+	var elems []reflect.Value
+	rest := content
+	for len(rest) > 0 {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		itemContent, r, err := splitItem(rest)
+		if err != nil {
+			return err
+		}
+		if err := decode(itemContent, elem); err != nil {
+			return err
+		}
+		elems = append(elems, elem)
+		rest = r
+	}
+	if v.Kind() == reflect.Array {
+		if len(elems) != v.Len() {
+			return ErrNonCanonicalSize
+		}
+		for i, e := range elems {
+			v.Index(i).Set(e)
+		}
+		return nil
+	}
+	out := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+	for i, e := range elems {
+		out.Index(i).Set(e)
+	}
+	v.Set(out)
+	return nil
+}
+
+func decodeBytes(content []byte, v reflect.Value) error {
+	if v.Kind() == reflect.Array {
+		if len(content) != v.Len() {
+			return ErrNonCanonicalSize
+		}
+		reflect.Copy(v, reflect.ValueOf(content))
+		return nil
+	}
+	out := make([]byte, len(content))
+	copy(out, content)
+	v.SetBytes(out)
+	return nil
+}
+
+func decodeUint(content []byte) (uint64, error) {
+	if len(content) > 8 {
+		return 0, fmt.Errorf("rlp: uint64 overflow")
+	}
+	if len(content) > 0 && content[0] == 0 {
+		return 0, ErrNonCanonicalInt
+	}
+	var u uint64
+	for _, b := range content {
+		u = u<<8 | uint64(b)
+	}
+	return u, nil
+}
+
+func decodeBigInt(content []byte, i *big.Int) error {
+	if len(content) > 0 && content[0] == 0 {
+		return ErrNonCanonicalInt
+	}
+	i.SetBytes(content)
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// helpers
+// ---------------------------------------------------------------------------
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+func bytesOf(v reflect.Value) []byte {
+	if v.Kind() == reflect.Slice {
+		return v.Bytes()
+	}
+	out := make([]byte, v.Len())
+	for i := range out {
+		out[i] = byte(v.Index(i).Uint())
+	}
+	return out
+}
+
+func minimalBigEndian(u uint64) []byte {
+	if u == 0 {
+		return nil
+	}
+	var buf [8]byte
+	n := 8
+	for i := 7; i >= 0; i-- {
+		buf[i] = byte(u)
+		u >>= 8
+		if buf[i] != 0 {
+			n = 8 - i
+		}
+	}
+	return buf[8-n:]
+}
+
+func wrapString(data []byte) []byte {
+	if len(data) == 1 && data[0] < 0x80 {
+		return []byte{data[0]}
+	}
+	if len(data) < 56 {
+		out := make([]byte, 0, len(data)+1)
+		out = append(out, 0x80+byte(len(data)))
+		return append(out, data...)
+	}
+	lenBytes := minimalBigEndian(uint64(len(data)))
+	out := make([]byte, 0, len(data)+1+len(lenBytes))
+	out = append(out, 0xb7+byte(len(lenBytes)))
+	out = append(out, lenBytes...)
+	return append(out, data...)
+}
+
+func wrapList(items [][]byte) []byte {
+	size := 0
+	for _, it := range items {
+		size += len(it)
+	}
+	var head []byte
+	if size < 56 {
+		head = []byte{0xc0 + byte(size)}
+	} else {
+		lenBytes := minimalBigEndian(uint64(size))
+		head = append([]byte{0xf7 + byte(len(lenBytes))}, lenBytes...)
+	}
+	out := make([]byte, 0, len(head)+size)
+	out = append(out, head...)
+	for _, it := range items {
+		out = append(out, it...)
+	}
+	return out
+}
+
+// splitItem parses a single RLP item (string or list) at the front of buf
+// and returns its raw content (without the length header) plus whatever
+// bytes follow it. It is the canonical-decode counterpart of wrapString /
+// wrapList and rejects redundant length encodings.
+func splitItem(buf []byte) (content, rest []byte, err error) {
+	if len(buf) == 0 {
+		return nil, nil, ErrTooShort
+	}
+	b0 := buf[0]
+	switch {
+	case b0 < 0x80:
+		return buf[0:1], buf[1:], nil
+
+	case b0 < 0xb8:
+		size := int(b0 - 0x80)
+		if len(buf) < 1+size {
+			return nil, nil, ErrTooShort
+		}
+		content = buf[1 : 1+size]
+		if size == 1 && content[0] < 0x80 {
+			return nil, nil, fmt.Errorf("rlp: non-canonical single byte string encoding")
+		}
+		return content, buf[1+size:], nil
+
+	case b0 < 0xc0:
+		lenOfLen := int(b0 - 0xb7)
+		if len(buf) < 1+lenOfLen {
+			return nil, nil, ErrTooShort
+		}
+		if buf[1] == 0 {
+			return nil, nil, fmt.Errorf("rlp: non-canonical length encoding")
+		}
+		size, err := decodeUint(buf[1 : 1+lenOfLen])
+		if err != nil {
+			return nil, nil, err
+		}
+		if size < 56 {
+			return nil, nil, fmt.Errorf("rlp: non-canonical length encoding")
+		}
+		end := 1 + lenOfLen + int(size)
+		if len(buf) < end {
+			return nil, nil, ErrTooShort
+		}
+		return buf[1+lenOfLen : end], buf[end:], nil
+
+	case b0 < 0xf8:
+		size := int(b0 - 0xc0)
+		if len(buf) < 1+size {
+			return nil, nil, ErrTooShort
+		}
+		return buf[1 : 1+size], buf[1+size:], nil
+
+	default:
+		lenOfLen := int(b0 - 0xf7)
+		if len(buf) < 1+lenOfLen {
+			return nil, nil, ErrTooShort
+		}
+		if buf[1] == 0 {
+			return nil, nil, fmt.Errorf("rlp: non-canonical length encoding")
+		}
+		size, err := decodeUint(buf[1 : 1+lenOfLen])
+		if err != nil {
+			return nil, nil, err
+		}
+		if size < 56 {
+			return nil, nil, fmt.Errorf("rlp: non-canonical length encoding")
+		}
+		end := 1 + lenOfLen + int(size)
+		if len(buf) < end {
+			return nil, nil, ErrTooShort
+		}
+		return buf[1+lenOfLen : end], buf[end:], nil
+	}
+}
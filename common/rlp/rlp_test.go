@@ -0,0 +1,119 @@
+package rlp
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+type simple struct {
+	A uint64
+	B []byte
+	C bool
+}
+
+type withOptional struct {
+	A uint64
+	B uint64 `rlp:"optional"`
+	C uint64 `rlp:"optional"`
+}
+
+type withTail struct {
+	A    uint64
+	Rest []uint64 `rlp:"tail"`
+}
+
+func roundTrip(t *testing.T, in, out interface{}) []byte {
+	t.Helper()
+	enc, err := EncodeToBytes(in)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := DecodeBytes(enc, out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return enc
+}
+
+func TestRoundTripSimple(t *testing.T) {
+	in := simple{A: 42, B: []byte("hello"), C: true}
+	var out simple
+	roundTrip(t, in, &out)
+	if out.A != in.A || !bytes.Equal(out.B, in.B) || out.C != in.C {
+		t.Fatalf("roundtrip mismatch: got %+v, want %+v", out, in)
+	}
+}
+
+func TestRoundTripOptionalTrailing(t *testing.T) {
+	in := withOptional{A: 7}
+	var out withOptional
+	enc := roundTrip(t, in, &out)
+	if out != in {
+		t.Fatalf("roundtrip mismatch: got %+v, want %+v", out, in)
+	}
+	// A trailing zero-valued optional field must not be present on the wire.
+	full, _ := EncodeToBytes(withOptional{A: 7, B: 1})
+	if len(full) <= len(enc) {
+		t.Fatalf("expected encoding with B set to be longer than without")
+	}
+}
+
+func TestRoundTripTail(t *testing.T) {
+	in := withTail{A: 1, Rest: []uint64{2, 3, 4}}
+	var out withTail
+	roundTrip(t, in, &out)
+	if out.A != in.A || len(out.Rest) != len(in.Rest) {
+		t.Fatalf("roundtrip mismatch: got %+v, want %+v", out, in)
+	}
+	for i := range in.Rest {
+		if in.Rest[i] != out.Rest[i] {
+			t.Fatalf("tail element %d mismatch: got %d, want %d", i, out.Rest[i], in.Rest[i])
+		}
+	}
+}
+
+func TestRoundTripBigInt(t *testing.T) {
+	in := big.NewInt(123456789)
+	var out big.Int
+	roundTrip(t, in, &out)
+	if in.Cmp(&out) != 0 {
+		t.Fatalf("roundtrip mismatch: got %s, want %s", out.String(), in.String())
+	}
+}
+
+func TestZeroUintIsEmptyString(t *testing.T) {
+	enc, err := EncodeToBytes(uint64(0))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if !bytes.Equal(enc, []byte{0x80}) {
+		t.Fatalf("zero uint64 should encode as empty string, got %x", enc)
+	}
+}
+
+func TestCanonicalRejectsLeadingZero(t *testing.T) {
+	// manually crafted encoding of a 2-byte string "\x00\x01" used as a uint
+	bad := []byte{0x82, 0x00, 0x01}
+	var out uint64
+	if err := DecodeBytes(bad, &out); err == nil {
+		t.Fatalf("expected non-canonical leading zero to be rejected")
+	}
+}
+
+func TestCanonicalRejectsExtraData(t *testing.T) {
+	enc, _ := EncodeToBytes(uint64(5))
+	bad := append(enc, 0xff)
+	var out uint64
+	if err := DecodeBytes(bad, &out); err == nil {
+		t.Fatalf("expected trailing bytes to be rejected")
+	}
+}
+
+func TestFixedArrayRejectsWrongLength(t *testing.T) {
+	type hash20 [20]byte
+	enc, _ := EncodeToBytes([]byte("too short"))
+	var out hash20
+	if err := DecodeBytes(enc, &out); err == nil {
+		t.Fatalf("expected wrong-length fixed array to be rejected")
+	}
+}
@@ -0,0 +1,75 @@
+package rlp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// field describes one struct field's participation in the wire encoding.
+// Descriptors are computed once per type (via cachedTypeInfo) instead of
+// being re-derived by reflection on every Serialize/Deserialize call.
+type field struct {
+	name     string
+	index    int
+	optional bool
+	tail     bool
+}
+
+var typeInfoCache sync.Map // map[reflect.Type][]field
+
+func cachedTypeInfo(typ reflect.Type) []field {
+	if cached, ok := typeInfoCache.Load(typ); ok {
+		return cached.([]field)
+	}
+	fields := buildTypeInfo(typ)
+	actual, _ := typeInfoCache.LoadOrStore(typ, fields)
+	return actual.([]field)
+}
+
+func buildTypeInfo(typ reflect.Type) []field {
+	var fields []field
+	tailSeen := false
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+		tag := parseTag(sf.Tag.Get("rlp"))
+		if tailSeen {
+			panic(fmt.Sprintf("rlp: tail field %s.%s must be the last field", typ, sf.Name))
+		}
+		if tag.tail {
+			tailSeen = true
+			if sf.Type.Kind() != reflect.Slice {
+				panic(fmt.Sprintf("rlp: tail field %s.%s must be a slice", typ, sf.Name))
+			}
+		}
+		fields = append(fields, field{
+			name:     sf.Name,
+			index:    i,
+			optional: tag.optional || tag.tail,
+			tail:     tag.tail,
+		})
+	}
+	return fields
+}
+
+type rlpTag struct {
+	optional bool
+	tail     bool
+}
+
+func parseTag(raw string) rlpTag {
+	var tag rlpTag
+	for _, part := range strings.Split(raw, ",") {
+		switch strings.TrimSpace(part) {
+		case "optional":
+			tag.optional = true
+		case "tail":
+			tag.tail = true
+		}
+	}
+	return tag
+}
@@ -0,0 +1,211 @@
+package conformance
+
+import (
+	"testing"
+)
+
+// fakeHarness is an in-memory stand-in used to exercise the Run/diff logic
+// itself, independent of chain.Chain / unconfirmed.Manager. A receive is
+// treated as failing with ErrOutOfQuota if any seeded account has quota
+// "0", so tests can exercise quota-style overrides without a real VM.
+type fakeHarness struct {
+	accounts      map[string]AccountState
+	unconfirmed   map[string][]string
+	receiveBlocks int
+}
+
+func newFakeHarness(pre PreState) (Harness, error) {
+	accounts := make(map[string]AccountState, len(pre.Accounts))
+	for _, a := range pre.Accounts {
+		accounts[a.Address] = a
+	}
+	return &fakeHarness{accounts: accounts}, nil
+}
+
+func (h *fakeHarness) Apply(in Input) (string, error) {
+	if in.Kind != "accountBlock" {
+		return "", nil
+	}
+	for _, a := range h.accounts {
+		if a.Quota == "0" {
+			return "ErrOutOfQuota", nil
+		}
+	}
+	h.receiveBlocks++
+	return "", nil
+}
+
+func (h *fakeHarness) State() (PostState, error) {
+	accounts := make([]AccountState, 0, len(h.accounts))
+	for _, a := range h.accounts {
+		accounts = append(accounts, a)
+	}
+	return PostState{
+		Accounts:      accounts,
+		Unconfirmed:   h.unconfirmed,
+		ReceiveBlocks: h.receiveBlocks,
+	}, nil
+}
+
+func TestRunDetectsMatchingState(t *testing.T) {
+	v := &Vector{
+		PreState: PreState{
+			Accounts: []AccountState{{Address: "vite_1", Balances: map[string]string{"vite_token": "100"}}},
+		},
+		Inputs: []Input{{Kind: "accountBlock"}},
+		PostState: PostState{
+			ReceiveBlocks: 1,
+			Accounts: []AccountState{
+				{Address: "vite_1", Balances: map[string]string{"vite_token": "100"}},
+			},
+		},
+	}
+
+	result, err := Run(v, newFakeHarness)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(result.Diffs) != 0 {
+		t.Fatalf("expected no diffs, got %v", result.Diffs)
+	}
+}
+
+func TestRunReportsMismatch(t *testing.T) {
+	v := &Vector{
+		PreState: PreState{
+			Accounts: []AccountState{{Address: "vite_1", Balances: map[string]string{"vite_token": "50"}}},
+		},
+		PostState: PostState{
+			Accounts: []AccountState{
+				{Address: "vite_1", Balances: map[string]string{"vite_token": "100"}},
+			},
+		},
+	}
+
+	result, err := Run(v, newFakeHarness)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(result.Diffs) != 1 {
+		t.Fatalf("expected exactly one diff, got %v", result.Diffs)
+	}
+}
+
+// TestRunReplaysVariantsWithTheirOwnOverrides asserts that a Variant's
+// Overrides actually reach the harness: the base vector has a zero-quota
+// account and expects ErrOutOfQuota, while its variant overrides quota to a
+// non-zero value and expects the receive to go through instead.
+func TestRunReplaysVariantsWithTheirOwnOverrides(t *testing.T) {
+	v := &Vector{
+		PreState:  PreState{Accounts: []AccountState{{Address: "vite_1", Quota: "0"}}},
+		Inputs:    []Input{{Kind: "accountBlock"}},
+		PostState: PostState{ErrorClass: "ErrOutOfQuota"},
+		Variants: []Variant{
+			{
+				Name:      "sufficient-quota",
+				Overrides: map[string]interface{}{"quota": "21000"},
+				PostState: &PostState{ReceiveBlocks: 1},
+			},
+		},
+	}
+
+	result, err := Run(v, newFakeHarness)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(result.Diffs) != 0 {
+		t.Fatalf("expected base case to match, got %v", result.Diffs)
+	}
+	if len(result.Variants) != 1 {
+		t.Fatalf("expected 1 variant result, got %d", len(result.Variants))
+	}
+	if diffs := result.Variants[0].Diffs; len(diffs) != 0 {
+		t.Fatalf("expected sufficient-quota variant to match its own postState, got %v", diffs)
+	}
+}
+
+// TestRunReportsVariantMismatch asserts a variant whose override should
+// have changed the outcome, but whose declared postState doesn't reflect
+// that, is reported as a mismatch rather than silently ignored.
+func TestRunReportsVariantMismatch(t *testing.T) {
+	v := &Vector{
+		PreState:  PreState{Accounts: []AccountState{{Address: "vite_1", Quota: "0"}}},
+		Inputs:    []Input{{Kind: "accountBlock"}},
+		PostState: PostState{ErrorClass: "ErrOutOfQuota"},
+		Variants: []Variant{
+			{
+				Name:      "sufficient-quota",
+				Overrides: map[string]interface{}{"quota": "21000"},
+				PostState: &PostState{ErrorClass: "ErrOutOfQuota"},
+			},
+		},
+	}
+
+	result, err := Run(v, newFakeHarness)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(result.Variants) != 1 || len(result.Variants[0].Diffs) == 0 {
+		t.Fatalf("expected variant mismatch to be reported, got %+v", result.Variants)
+	}
+}
+
+// TestVectorCorpusShape walks the testdata/vectors corpus and checks that
+// every vector is well-formed enough to eventually replay: it has a name,
+// at least one input, and every variant has a name. This can fail on a
+// malformed vector even though the replay itself is not run yet.
+//
+// This is harness scaffolding only, not the conformance coverage the
+// request asked for ("replay inputs through ContractWorker.FetchNewFromDb
+// / AutoReceiveWorker.ProcessOneBlock against an in-memory chain.Chain +
+// unconfirmed.Manager"). Wiring that up for real is blocked on more than
+// a missing type:
+//
+//   - chain.Chain does not exist in this checkout (chain/ only has
+//     chain/benchmark).
+//   - unconfirmed.Manager is referenced (the *Manager field on
+//     ContractWorker and AutoReceiveWorker) but never defined anywhere
+//     in unconfirmed/.
+//   - ContractWorker.FetchNewFromDb itself depends on
+//     unconfirmed/model, verifier, and producer, none of which exist as
+//     packages in this checkout either, so unconfirmed doesn't compile
+//     standalone yet.
+//   - AutoReceiveWorker.ProcessOneBlock, the other entry point the
+//     request names, is an unimplemented stub in this checkout (every
+//     step is a "// todo" comment and the body does nothing) — there is
+//     no receive semantics for a harness to verify on that path yet.
+//
+// Faking all of the above just to drive a no-op would produce fictional
+// coverage, not real conformance checking, so this is left as scoped
+// scaffolding: TestRunDetects*/TestRunReports* above exercise the real
+// Run/diff plumbing against fakeHarness, and this test only guards the
+// corpus format. Wiring Harness/NewHarness to the real types is tracked
+// as follow-up work once chain.Chain, unconfirmed.Manager and
+// AutoReceiveWorker.ProcessOneBlock actually exist; it is not done here,
+// and this test intentionally does not assert anything about
+// receive/contract-worker semantics.
+func TestVectorCorpusShape(t *testing.T) {
+	vectors, err := LoadVectors("testdata/vectors")
+	if err != nil {
+		t.Fatalf("LoadVectors: %v", err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("expected at least one vector in testdata/vectors")
+	}
+
+	for _, v := range vectors {
+		if v.Name == "" {
+			t.Fatalf("vector missing a name")
+		}
+		if len(v.Inputs) == 0 {
+			t.Fatalf("vector %s: no inputs to replay", v.Name)
+		}
+		for _, variant := range v.Variants {
+			if variant.Name == "" {
+				t.Fatalf("vector %s: variant missing a name", v.Name)
+			}
+		}
+	}
+
+	t.Skip("conformance: blocked on a missing chain.Chain package and an undefined unconfirmed.Manager type; corpus checked for shape only, not replayed")
+}
@@ -0,0 +1,37 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LoadVectors reads every *.json file under dir and decodes it as a Vector.
+// Files are returned sorted by name so a corpus replays in a deterministic
+// order regardless of filesystem listing order.
+func LoadVectors(dir string) ([]*Vector, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	vectors := make([]*Vector, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("conformance: reading %s: %w", path, err)
+		}
+		v := new(Vector)
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, fmt.Errorf("conformance: parsing %s: %w", path, err)
+		}
+		if v.Name == "" {
+			v.Name = filepath.Base(path)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,188 @@
+package conformance
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Harness is whatever implementation a vector is replayed against. The
+// interface doesn't depend on the ledger/unconfirmed packages, so the same
+// corpus can drive any implementation; the only Harness in this package
+// today is the in-memory fake used by its own tests.
+type Harness interface {
+	// Apply replays one Input (accountBlock or snapshotBlock) against the
+	// harness's chain/pool, returning the error class string ("" if none)
+	// the vector should compare against PostState.ErrorClass.
+	Apply(in Input) (errorClass string, err error)
+
+	// State snapshots the harness's current view as a PostState so it can
+	// be diffed against the vector's expectation.
+	State() (PostState, error)
+}
+
+// NewHarness builds a fresh Harness seeded from pre. Run calls it once for
+// the vector's own PreState and again, with an overridden PreState, for
+// every Variant that declares its own PostState, so variants replay against
+// isolated state instead of sharing one mutated harness.
+type NewHarness func(pre PreState) (Harness, error)
+
+// VariantResult is one Variant's diff against its own PostState.
+type VariantResult struct {
+	Name  string
+	Diffs []string
+}
+
+// RunResult is the outcome of replaying a Vector: the base case's diffs plus
+// one VariantResult per Variant that declared a PostState to check against.
+type RunResult struct {
+	Diffs    []string
+	Variants []VariantResult
+}
+
+// Run replays v.Inputs against a harness seeded from v.PreState and diffs
+// the result against v.PostState, then does the same for every Variant that
+// declares its own PostState: a fresh harness is built from v.PreState with
+// that variant's Overrides applied, so overrides and their expected
+// PostState actually get exercised rather than sitting in the corpus
+// unread. Variants with no PostState are documentation only and are not
+// replayed.
+func Run(v *Vector, newHarness NewHarness) (*RunResult, error) {
+	diffs, err := replay(v.PreState, v.Inputs, v.PostState, newHarness)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RunResult{Diffs: diffs}
+	for _, variant := range v.Variants {
+		if variant.PostState == nil {
+			continue
+		}
+		pre := applyOverrides(v.PreState, variant.Overrides)
+		vDiffs, err := replay(pre, v.Inputs, *variant.PostState, newHarness)
+		if err != nil {
+			return nil, fmt.Errorf("conformance: variant %s: %w", variant.Name, err)
+		}
+		result.Variants = append(result.Variants, VariantResult{Name: variant.Name, Diffs: vDiffs})
+	}
+	return result, nil
+}
+
+// replay seeds a fresh harness from pre, applies inputs in order, and diffs
+// the resulting state against want.
+func replay(pre PreState, inputs []Input, want PostState, newHarness NewHarness) ([]string, error) {
+	h, err := newHarness(pre)
+	if err != nil {
+		return nil, fmt.Errorf("conformance: building harness: %w", err)
+	}
+
+	var lastErrorClass string
+	for _, in := range inputs {
+		class, err := h.Apply(in)
+		if err != nil {
+			return nil, fmt.Errorf("conformance: applying input kind=%s: %w", in.Kind, err)
+		}
+		if class != "" {
+			lastErrorClass = class
+		}
+	}
+
+	got, err := h.State()
+	if err != nil {
+		return nil, fmt.Errorf("conformance: reading harness state: %w", err)
+	}
+	got.ErrorClass = lastErrorClass
+
+	return diffPostState(want, got), nil
+}
+
+// applyOverrides returns a copy of pre with a variant's overrides applied.
+// The only key understood today is "quota", which sets every account's
+// Quota (e.g. to simulate the account being topped up before replay);
+// unknown keys are ignored so the format can grow without every existing
+// variant needing updating.
+func applyOverrides(pre PreState, overrides map[string]interface{}) PreState {
+	out := pre
+	out.Accounts = make([]AccountState, len(pre.Accounts))
+	copy(out.Accounts, pre.Accounts)
+
+	quota, ok := overrides["quota"].(string)
+	if !ok {
+		return out
+	}
+	for i := range out.Accounts {
+		out.Accounts[i].Quota = quota
+	}
+	return out
+}
+
+func diffPostState(want, got PostState) []string {
+	var diffs []string
+
+	if want.ErrorClass != got.ErrorClass {
+		diffs = append(diffs, fmt.Sprintf("errorClass: want %q, got %q", want.ErrorClass, got.ErrorClass))
+	}
+	if want.ReceiveBlocks != got.ReceiveBlocks {
+		diffs = append(diffs, fmt.Sprintf("receiveBlocks: want %d, got %d", want.ReceiveBlocks, got.ReceiveBlocks))
+	}
+
+	diffs = append(diffs, diffAccounts(want.Accounts, got.Accounts)...)
+	diffs = append(diffs, diffUnconfirmed(want.Unconfirmed, got.Unconfirmed)...)
+
+	return diffs
+}
+
+func diffAccounts(want, got []AccountState) []string {
+	var diffs []string
+	index := make(map[string]AccountState, len(got))
+	for _, a := range got {
+		index[a.Address] = a
+	}
+	for _, w := range want {
+		g, ok := index[w.Address]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("account %s: missing from actual state", w.Address))
+			continue
+		}
+		if w.Quota != "" && w.Quota != g.Quota {
+			diffs = append(diffs, fmt.Sprintf("account %s: quota want %s, got %s", w.Address, w.Quota, g.Quota))
+		}
+		for token, amount := range w.Balances {
+			if g.Balances[token] != amount {
+				diffs = append(diffs, fmt.Sprintf("account %s: balance[%s] want %s, got %s", w.Address, token, amount, g.Balances[token]))
+			}
+		}
+	}
+	return diffs
+}
+
+func diffUnconfirmed(want, got map[string][]string) []string {
+	var diffs []string
+	addrs := make([]string, 0, len(want))
+	for addr := range want {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	for _, addr := range addrs {
+		wantHashes := append([]string{}, want[addr]...)
+		gotHashes := append([]string{}, got[addr]...)
+		sort.Strings(wantHashes)
+		sort.Strings(gotHashes)
+		if !equalStrings(wantHashes, gotHashes) {
+			diffs = append(diffs, fmt.Sprintf("unconfirmed[%s]: want %v, got %v", addr, wantHashes, gotHashes))
+		}
+	}
+	return diffs
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
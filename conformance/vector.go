@@ -0,0 +1,62 @@
+// Package conformance declares a portable, data-driven test-vector format
+// for the ledger/unconfirmed subsystems: a preState, a list of inputs to
+// replay, and an expected postState. The actual replay/diff logic is
+// supplied by the caller (see Harness), so the same corpus can eventually
+// be pointed at a different implementation entirely.
+//
+// As of this checkout, no caller wires Harness to the real ledger/
+// unconfirmed types (see TestVectorCorpusShape in conformance_test.go for
+// why); the testdata/vectors corpus and the Run/diff plumbing exist so
+// that a real Harness can be dropped in later without reshaping the
+// format.
+package conformance
+
+import "encoding/json"
+
+// AccountState is a snapshot of one account's balances and quota, used in
+// both PreState and PostState.
+type AccountState struct {
+	Address  string            `json:"address"`
+	Balances map[string]string `json:"balances"` // tokenId -> decimal string
+	Quota    string            `json:"quota,omitempty"`
+}
+
+// PreState is the state the in-memory chain/unconfirmed pool must be seeded
+// with before a vector's inputs are replayed.
+type PreState struct {
+	SnapshotHeight uint64         `json:"snapshotHeight"`
+	Accounts       []AccountState `json:"accounts"`
+}
+
+// Input is one block to replay, in the order it appears in the vector.
+type Input struct {
+	Kind string          `json:"kind"` // "accountBlock" | "snapshotBlock"
+	Raw  json.RawMessage `json:"raw"`
+}
+
+// PostState is what the vector asserts holds true after all Inputs (and any
+// Variant overrides) have been replayed.
+type PostState struct {
+	Accounts      []AccountState      `json:"accounts"`
+	Unconfirmed   map[string][]string `json:"unconfirmed"` // address -> hashes
+	ReceiveBlocks int                 `json:"receiveBlocks"`
+	ErrorClass    string              `json:"errorClass,omitempty"` // expected error, if any
+}
+
+// Variant tweaks a copy of the vector (e.g. gas price / quota) and is
+// expected to produce its own PostState override.
+type Variant struct {
+	Name      string                 `json:"name"`
+	Overrides map[string]interface{} `json:"overrides"`
+	PostState *PostState             `json:"postState,omitempty"`
+}
+
+// Vector is one self-contained conformance case.
+type Vector struct {
+	Name      string    `json:"name"`
+	Skip      string    `json:"skip,omitempty"` // non-empty => reason to skip, not a failure
+	PreState  PreState  `json:"preState"`
+	Inputs    []Input   `json:"inputs"`
+	PostState PostState `json:"postState"`
+	Variants  []Variant `json:"variants,omitempty"`
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"math/big"
+
+	"github.com/vitelabs/go-vite/common/types"
+	"github.com/vitelabs/go-vite/ledger"
+)
+
+// accountChainAccess is the slice of the account chain access layer
+// AccountChain depends on. It is declared here, on the consumer side, so
+// any concrete access-layer implementation (or a fake, for tests) can be
+// plugged in without AccountChain needing to import it directly.
+type accountChainAccess interface {
+	GetAccountMeta(addr *types.Address) (*ledger.AccountMeta, error)
+
+	// MutateDiff applies block to the state trie and returns the resulting
+	// unconfirmed meta and account quota without touching disk.
+	MutateDiff(block *ledger.AccountBlock) (*ledger.UnconfirmedMeta, *big.Int, error)
+
+	// CommitDiffLayer flushes a previously computed mutation to disk.
+	CommitDiffLayer(block *ledger.AccountBlock, meta *ledger.UnconfirmedMeta) error
+}
+
+// unconfirmedAccess is the slice of the unconfirmed-pool access layer
+// AccountChain depends on.
+type unconfirmedAccess interface {
+	GetUnconfirmedAccountMeta(addr *types.Address) (*ledger.UnconfirmedMeta, error)
+	GetUnconfirmedHashs(index, num, count int, accountId *big.Int, tokenId *types.TokenTypeId) ([]*types.Hash, error)
+	GetAccountQuota(addr types.Address, snapshotHash types.Hash) *big.Int
+}
+
+// tokenAccess is the slice of the token access layer AccountChain depends on.
+type tokenAccess interface {
+	GetByTokenId(tokenId *types.TokenTypeId) (*ledger.Token, error)
+}
+
+// blockValidator runs stage 1 (signature/structure checks) before a block
+// is allowed to mutate state. It is its own interface, distinct from the
+// access layer, so tests can exercise Pipeline.Insert's error propagation
+// without depending on ledger.AccountBlock's real signature scheme.
+type blockValidator interface {
+	Validate(block *ledger.AccountBlock) error
+}
+
+type defaultValidator struct{}
+
+func (defaultValidator) Validate(block *ledger.AccountBlock) error {
+	return block.VerifySignature()
+}
+
+// AccountChain is the RPC-facing handler around the account chain access
+// layer: it packs/unpacks DB-level structures into the shapes the JSON-RPC
+// API wants, and owns the insertion pipeline (see pipeline.go) that keeps
+// block validation, trie mutation and disk commit decoupled.
+type AccountChain struct {
+	aAccess   accountChainAccess
+	uAccess   unconfirmedAccess
+	tAccess   tokenAccess
+	validator blockValidator
+
+	pipeline *Pipeline
+	snapshot *Snapshot
+}
+
+// NewAccountChain wires an AccountChain on top of the given access layer and
+// starts its insertion pipeline with default tuning.
+func NewAccountChain(aAccess accountChainAccess, uAccess unconfirmedAccess, tAccess tokenAccess) *AccountChain {
+	ac := &AccountChain{
+		aAccess:   aAccess,
+		uAccess:   uAccess,
+		tAccess:   tAccess,
+		validator: defaultValidator{},
+		snapshot:  NewSnapshot(DefaultMaxLayerDepth),
+	}
+	ac.pipeline = NewPipeline(ac, DefaultPipelineConfig())
+	ac.pipeline.Start()
+	return ac
+}
+
+// Stop drains and stops the insertion pipeline.
+func (ac *AccountChain) Stop() {
+	ac.pipeline.Stop()
+}
@@ -0,0 +1,305 @@
+package handler
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/vitelabs/go-vite/common/types"
+	"github.com/vitelabs/go-vite/ledger"
+	"github.com/vitelabs/go-vite/log15"
+	"github.com/vitelabs/go-vite/metrics"
+)
+
+const (
+	// DefaultMaxLayerDepth is how many uncommitted difflayers a single
+	// snapshot hash may accumulate before Insert starts blocking the
+	// caller until stage 3 (disk commit) catches up.
+	DefaultMaxLayerDepth = 8
+
+	// defaultQueueDepth bounds the channel between stage 2 (mutate) and
+	// stage 3 (commit) so a slow disk can't let an unbounded number of
+	// difflayers pile up in memory.
+	defaultQueueDepth = 64
+)
+
+var pipelineLog = log15.New("module", "ledger/handler/pipeline")
+
+var (
+	validateLatency  = metrics.NewRegisteredTimer("chain/pipeline/validate", nil)
+	mutateLatency    = metrics.NewRegisteredTimer("chain/pipeline/mutate", nil)
+	commitLatency    = metrics.NewRegisteredTimer("chain/pipeline/commit", nil)
+	commitQueueGauge = metrics.NewRegisteredGauge("chain/pipeline/commit_queue_depth", nil)
+)
+
+// PipelineConfig tunes the insertion pipeline.
+type PipelineConfig struct {
+	// QueueDepth bounds the in-flight difflayers waiting for stage 3 (async
+	// disk commit). Once full, Insert blocks, which back-pressures stage 1/2.
+	QueueDepth int
+}
+
+// DefaultPipelineConfig returns the tuning used when none is supplied.
+func DefaultPipelineConfig() PipelineConfig {
+	return PipelineConfig{QueueDepth: defaultQueueDepth}
+}
+
+// DiffLayer is the in-memory result of mutating the state trie for a single
+// account block. It is handed from stage 2 (mutate) to stage 3 (commit) and,
+// until committed, also lives on the Snapshot stack so reads can be served
+// without waiting for disk.
+type DiffLayer struct {
+	SnapshotHash types.Hash
+	Block        *ledger.AccountBlock
+
+	// UnconfirmedMeta/AccountQuota are the post-mutation values a reader
+	// would see if this layer were already the committed tip.
+	UnconfirmedMeta *ledger.UnconfirmedMeta
+	AccountQuota    *big.Int
+
+	done chan error
+}
+
+// Wait blocks until stage 3 has attempted to commit this layer to disk and
+// returns the result. Callers that only care about validate/mutate success
+// (the return value of Insert) don't need to call this.
+func (d *DiffLayer) Wait() error {
+	return <-d.done
+}
+
+// Snapshot holds, per snapshot hash, a stack of not-yet-committed
+// DiffLayers so reads can be served from the freshest in-memory state while
+// stage 3 is still flushing older layers to disk.
+type Snapshot struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	layers   map[types.Hash][]*DiffLayer
+	maxDepth int
+}
+
+// NewSnapshot creates a Snapshot that makes Push report overflow once a
+// single snapshot hash accumulates more than maxDepth uncommitted layers.
+func NewSnapshot(maxDepth int) *Snapshot {
+	s := &Snapshot{
+		layers:   make(map[types.Hash][]*DiffLayer),
+		maxDepth: maxDepth,
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Push adds layer to the top of the stack for its snapshot hash. It returns
+// true if the stack is now deeper than maxDepth, meaning the caller should
+// wait (see WaitUntilBelowMax) for stage 3 to catch up before continuing,
+// instead of committing layer itself out of turn.
+func (s *Snapshot) Push(layer *DiffLayer) (overflow bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stack := append(s.layers[layer.SnapshotHash], layer)
+	s.layers[layer.SnapshotHash] = stack
+	return len(stack) > s.maxDepth
+}
+
+// Pop removes layer from the bottom of its stack once stage 3 has committed
+// it to disk, and wakes up anyone blocked in WaitUntilBelowMax.
+func (s *Snapshot) Pop(layer *DiffLayer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stack := s.layers[layer.SnapshotHash]
+	for i, l := range stack {
+		if l == layer {
+			stack = append(stack[:i], stack[i+1:]...)
+			break
+		}
+	}
+	if len(stack) == 0 {
+		delete(s.layers, layer.SnapshotHash)
+	} else {
+		s.layers[layer.SnapshotHash] = stack
+	}
+	s.cond.Broadcast()
+}
+
+// WaitUntilBelowMax blocks until snapshotHash's uncommitted layer count is
+// at most maxDepth. Stage 3 always commits in the order layers were queued
+// (it is the sole consumer of a single FIFO channel), so waiting here never
+// skips a layer ahead of older ones for the same snapshot hash: it only
+// slows down the producer until the backlog drains.
+func (s *Snapshot) WaitUntilBelowMax(snapshotHash types.Hash) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.layers[snapshotHash]) > s.maxDepth {
+		s.cond.Wait()
+	}
+}
+
+// Latest returns the freshest uncommitted layer for addr under snapshotHash,
+// or nil if there isn't one, so reads can skip straight to disk.
+func (s *Snapshot) Latest(snapshotHash types.Hash, addr types.Address) *DiffLayer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stack := s.layers[snapshotHash]
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Block.AccountAddress == addr {
+			return stack[i]
+		}
+	}
+	return nil
+}
+
+// Depth reports how many uncommitted layers are stacked for snapshotHash.
+func (s *Snapshot) Depth(snapshotHash types.Hash) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.layers[snapshotHash])
+}
+
+// Pipeline decouples block insertion into three stages so stage 3 (disk
+// commit) does not hold up the next block's validation/mutation, except as
+// back-pressure when the commit queue is full or a snapshot hash exceeds
+// the Snapshot's maxDepth:
+//
+//	validate -> mutate (in-memory difflayer) -> async commit
+//
+// Stages 1 and 2 run synchronously inside Insert, so a caller always learns
+// immediately whether its block was accepted; only stage 3 happens in the
+// background, via the single runCommit goroutine reading commitCh in the
+// order layers were queued.
+type Pipeline struct {
+	ac     *AccountChain
+	config PipelineConfig
+
+	commitCh chan *DiffLayer
+
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewPipeline builds a Pipeline bound to ac. Call Start to launch its
+// stage 3 commit goroutine.
+func NewPipeline(ac *AccountChain, config PipelineConfig) *Pipeline {
+	return &Pipeline{
+		ac:       ac,
+		config:   config,
+		commitCh: make(chan *DiffLayer, config.QueueDepth),
+	}
+}
+
+// Start launches the stage 3 (commit) goroutine.
+func (p *Pipeline) Start() {
+	p.wg.Add(1)
+	go p.runCommit()
+}
+
+// Stop closes the pipeline and waits for the commit stage to drain.
+func (p *Pipeline) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.commitCh)
+	})
+	p.wg.Wait()
+}
+
+// Insert runs stage 1 (validate) and stage 2 (mutate) synchronously and
+// returns their outcome directly to the caller. On success, the resulting
+// DiffLayer is hand off to stage 3 for an async disk commit; call
+// DiffLayer.Wait if the caller needs to know the commit also succeeded. If
+// pushing this layer leaves its snapshot hash with more than the Snapshot's
+// maxDepth uncommitted layers, Insert blocks until stage 3 has caught up,
+// instead of letting the backlog (and memory use) grow unbounded.
+func (p *Pipeline) Insert(block *ledger.AccountBlock) (*DiffLayer, error) {
+	start := time.Now()
+	if err := p.ac.validateBlock(block); err != nil {
+		pipelineLog.Error("validate failed", "hash", block.Hash, "err", err)
+		return nil, err
+	}
+	validateLatency.UpdateSince(start)
+
+	mutateStart := time.Now()
+	layer, err := p.ac.mutateState(block)
+	if err != nil {
+		pipelineLog.Error("mutate failed", "hash", block.Hash, "err", err)
+		return nil, err
+	}
+	mutateLatency.UpdateSince(mutateStart)
+
+	overflow := p.ac.snapshot.Push(layer)
+
+	commitQueueGauge.Update(int64(len(p.commitCh)))
+	p.commitCh <- layer
+
+	if overflow {
+		p.ac.snapshot.WaitUntilBelowMax(layer.SnapshotHash)
+	}
+
+	return layer, nil
+}
+
+func (p *Pipeline) runCommit() {
+	defer p.wg.Done()
+	for layer := range p.commitCh {
+		p.commitOne(layer)
+	}
+}
+
+func (p *Pipeline) commitOne(layer *DiffLayer) {
+	start := time.Now()
+	err := p.ac.commitDiffLayer(layer)
+	commitLatency.UpdateSince(start)
+	// Pop unconditionally: a failed commit still has to come off the
+	// Snapshot stack, or its SnapshotHash's Depth never shrinks and a
+	// future Push can wedge WaitUntilBelowMax forever. Pop before signalling
+	// done so that a reader returning from Wait no longer sees this layer.
+	p.ac.snapshot.Pop(layer)
+	layer.done <- err
+	if err != nil {
+		pipelineLog.Error("commit failed", "hash", layer.Block.Hash, "err", err)
+	}
+}
+
+// validateBlock runs stage 1 checks before a block is allowed to mutate
+// state, via ac.validator so tests can substitute a fake.
+func (ac *AccountChain) validateBlock(block *ledger.AccountBlock) error {
+	return ac.validator.Validate(block)
+}
+
+// mutateState applies block to the state trie and returns the resulting
+// in-memory difflayer without touching disk.
+func (ac *AccountChain) mutateState(block *ledger.AccountBlock) (*DiffLayer, error) {
+	unconfirmedMeta, quota, err := ac.aAccess.MutateDiff(block)
+	if err != nil {
+		return nil, err
+	}
+	return &DiffLayer{
+		SnapshotHash:    block.SnapshotHash,
+		Block:           block,
+		UnconfirmedMeta: unconfirmedMeta,
+		AccountQuota:    quota,
+		done:            make(chan error, 1),
+	}, nil
+}
+
+// commitDiffLayer flushes layer to disk via the access layer.
+func (ac *AccountChain) commitDiffLayer(layer *DiffLayer) error {
+	return ac.aAccess.CommitDiffLayer(layer.Block, layer.UnconfirmedMeta)
+}
+
+// GetUnconfirmedAccountMetaFresh serves GetUnconfirmedAccountMeta from the
+// freshest in-memory difflayer for snapshotHash when one exists, falling
+// back to the committed value via GetUnconfirmedAccountMeta (backed by
+// ac.uAccess) otherwise.
+func (ac *AccountChain) GetUnconfirmedAccountMetaFresh(snapshotHash types.Hash, addr *types.Address) (*ledger.UnconfirmedMeta, error) {
+	if layer := ac.snapshot.Latest(snapshotHash, *addr); layer != nil {
+		return layer.UnconfirmedMeta, nil
+	}
+	return ac.GetUnconfirmedAccountMeta(addr)
+}
+
+// GetAccountQuota serves the account's quota from the freshest in-memory
+// difflayer for snapshotHash when one exists, falling back to the access
+// layer otherwise, so quota checks don't have to wait for disk commit.
+func (ac *AccountChain) GetAccountQuota(addr types.Address, snapshotHash types.Hash) *big.Int {
+	if layer := ac.snapshot.Latest(snapshotHash, addr); layer != nil {
+		return layer.AccountQuota
+	}
+	return ac.uAccess.GetAccountQuota(addr, snapshotHash)
+}
@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vitelabs/go-vite/common/types"
+	"github.com/vitelabs/go-vite/ledger"
+)
+
+// fakeAccess is a minimal in-memory stand-in for the access layer, used to
+// drive Pipeline.Insert end to end without a real trie/DB.
+type fakeAccess struct {
+	mu sync.Mutex
+
+	commitOrder []types.Hash
+	commitDelay time.Duration
+	failMutate  map[types.Hash]error
+	failCommit  map[types.Hash]error
+
+	// mutateQuota overrides the quota MutateDiff hands back for the fresh
+	// in-memory layer; nil keeps the default of big.NewInt(0).
+	mutateQuota *big.Int
+}
+
+func newFakeAccess() *fakeAccess {
+	return &fakeAccess{
+		failMutate: make(map[types.Hash]error),
+		failCommit: make(map[types.Hash]error),
+	}
+}
+
+func (f *fakeAccess) GetAccountMeta(addr *types.Address) (*ledger.AccountMeta, error) {
+	return &ledger.AccountMeta{}, nil
+}
+
+func (f *fakeAccess) MutateDiff(block *ledger.AccountBlock) (*ledger.UnconfirmedMeta, *big.Int, error) {
+	if err := f.failMutate[block.Hash]; err != nil {
+		return nil, nil, err
+	}
+	quota := f.mutateQuota
+	if quota == nil {
+		quota = big.NewInt(0)
+	}
+	return &ledger.UnconfirmedMeta{}, quota, nil
+}
+
+func (f *fakeAccess) CommitDiffLayer(block *ledger.AccountBlock, meta *ledger.UnconfirmedMeta) error {
+	if f.commitDelay > 0 {
+		time.Sleep(f.commitDelay)
+	}
+	f.mu.Lock()
+	f.commitOrder = append(f.commitOrder, block.Hash)
+	f.mu.Unlock()
+	return f.failCommit[block.Hash]
+}
+
+func (f *fakeAccess) orderedHashes() []types.Hash {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]types.Hash, len(f.commitOrder))
+	copy(out, f.commitOrder)
+	return out
+}
+
+// fakeUnconfirmedAccess is the fallback-to-disk side of uAccess; diskMeta
+// and diskQuota let a test plant values distinguishable from whatever the
+// fresh in-memory layer holds, so reads that fall through to disk can be
+// told apart from reads served from the Snapshot stack.
+type fakeUnconfirmedAccess struct {
+	diskMeta  *ledger.UnconfirmedMeta
+	diskQuota *big.Int
+}
+
+func (f fakeUnconfirmedAccess) GetUnconfirmedAccountMeta(addr *types.Address) (*ledger.UnconfirmedMeta, error) {
+	if f.diskMeta != nil {
+		return f.diskMeta, nil
+	}
+	return &ledger.UnconfirmedMeta{}, nil
+}
+
+func (fakeUnconfirmedAccess) GetUnconfirmedHashs(index, num, count int, accountId *big.Int, tokenId *types.TokenTypeId) ([]*types.Hash, error) {
+	return nil, nil
+}
+
+func (f fakeUnconfirmedAccess) GetAccountQuota(addr types.Address, snapshotHash types.Hash) *big.Int {
+	if f.diskQuota != nil {
+		return f.diskQuota
+	}
+	return big.NewInt(0)
+}
+
+type fakeTokenAccess struct{}
+
+func (fakeTokenAccess) GetByTokenId(tokenId *types.TokenTypeId) (*ledger.Token, error) {
+	return &ledger.Token{}, nil
+}
+
+// fakeValidator lets individual tests fail specific blocks in stage 1
+// without depending on ledger.AccountBlock's real signature scheme.
+type fakeValidator struct {
+	fail map[types.Hash]error
+}
+
+func (v fakeValidator) Validate(block *ledger.AccountBlock) error {
+	return v.fail[block.Hash]
+}
+
+func newTestAccountChain(access *fakeAccess, validator blockValidator, maxLayerDepth int) *AccountChain {
+	ac := &AccountChain{
+		aAccess:   access,
+		uAccess:   fakeUnconfirmedAccess{},
+		tAccess:   fakeTokenAccess{},
+		validator: validator,
+		snapshot:  NewSnapshot(maxLayerDepth),
+	}
+	ac.pipeline = NewPipeline(ac, PipelineConfig{QueueDepth: 16})
+	ac.pipeline.Start()
+	return ac
+}
+
+func blockWithHash(snapshotHash types.Hash, b byte) *ledger.AccountBlock {
+	var hash types.Hash
+	hash[0] = b
+	return &ledger.AccountBlock{Hash: hash, SnapshotHash: snapshotHash}
+}
+
+func TestInsertPropagatesValidateError(t *testing.T) {
+	access := newFakeAccess()
+	wantErr := errors.New("bad signature")
+	block := blockWithHash(types.Hash{}, 1)
+	validator := fakeValidator{fail: map[types.Hash]error{block.Hash: wantErr}}
+
+	ac := newTestAccountChain(access, validator, DefaultMaxLayerDepth)
+	defer ac.Stop()
+
+	layer, err := ac.pipeline.Insert(block)
+	if err != wantErr {
+		t.Fatalf("expected validate error to propagate, got %v", err)
+	}
+	if layer != nil {
+		t.Fatalf("expected no layer on validate failure")
+	}
+	if got := access.orderedHashes(); len(got) != 0 {
+		t.Fatalf("invalid block must never reach commit, got %v", got)
+	}
+}
+
+func TestInsertPropagatesMutateError(t *testing.T) {
+	access := newFakeAccess()
+	block := blockWithHash(types.Hash{}, 1)
+	wantErr := errors.New("trie mutation failed")
+	access.failMutate[block.Hash] = wantErr
+
+	ac := newTestAccountChain(access, fakeValidator{}, DefaultMaxLayerDepth)
+	defer ac.Stop()
+
+	_, err := ac.pipeline.Insert(block)
+	if err != wantErr {
+		t.Fatalf("expected mutate error to propagate, got %v", err)
+	}
+	if got := access.orderedHashes(); len(got) != 0 {
+		t.Fatalf("block that failed to mutate must never reach commit, got %v", got)
+	}
+}
+
+func TestInsertSurfacesCommitFailureViaWait(t *testing.T) {
+	access := newFakeAccess()
+	block := blockWithHash(types.Hash{}, 1)
+	wantErr := errors.New("disk full")
+	access.failCommit[block.Hash] = wantErr
+
+	ac := newTestAccountChain(access, fakeValidator{}, DefaultMaxLayerDepth)
+	defer ac.Stop()
+
+	layer, err := ac.pipeline.Insert(block)
+	if err != nil {
+		t.Fatalf("Insert should only report validate/mutate errors, got %v", err)
+	}
+	if err := layer.Wait(); err != wantErr {
+		t.Fatalf("expected commit error via Wait, got %v", err)
+	}
+}
+
+// TestFreshReadsFallBackToDiskAfterCommit exercises the two methods that
+// actually deliver "serve reads from the freshest layer without waiting
+// for disk commit": GetUnconfirmedAccountMetaFresh and GetAccountQuota
+// must return the in-memory layer's values while the layer is still on
+// the Snapshot stack, then fall back to the access-layer (disk) values
+// once the layer has been popped after a successful commit.
+func TestFreshReadsFallBackToDiskAfterCommit(t *testing.T) {
+	access := newFakeAccess()
+	access.commitDelay = 50 * time.Millisecond
+	access.mutateQuota = big.NewInt(42)
+
+	uAccess := fakeUnconfirmedAccess{
+		diskMeta:  &ledger.UnconfirmedMeta{},
+		diskQuota: big.NewInt(7),
+	}
+
+	ac := &AccountChain{
+		aAccess:   access,
+		uAccess:   uAccess,
+		tAccess:   fakeTokenAccess{},
+		validator: fakeValidator{},
+		snapshot:  NewSnapshot(DefaultMaxLayerDepth),
+	}
+	ac.pipeline = NewPipeline(ac, PipelineConfig{QueueDepth: 16})
+	ac.pipeline.Start()
+	defer ac.Stop()
+
+	snapshotHash := types.Hash{}
+	block := blockWithHash(snapshotHash, 1)
+	addr := block.AccountAddress
+
+	layer, err := ac.pipeline.Insert(block)
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	// commitDelay guarantees stage 3 hasn't committed yet, so the layer is
+	// still on the Snapshot stack and reads must be served from it.
+	if meta, err := ac.GetUnconfirmedAccountMetaFresh(snapshotHash, &addr); err != nil {
+		t.Fatalf("GetUnconfirmedAccountMetaFresh: %v", err)
+	} else if meta != layer.UnconfirmedMeta {
+		t.Fatalf("expected the in-memory layer's meta before commit, got %+v", meta)
+	}
+	if quota := ac.GetAccountQuota(addr, snapshotHash); quota.Cmp(layer.AccountQuota) != 0 {
+		t.Fatalf("expected the in-memory layer's quota (%s) before commit, got %s", layer.AccountQuota, quota)
+	}
+
+	if err := layer.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	if meta, err := ac.GetUnconfirmedAccountMetaFresh(snapshotHash, &addr); err != nil {
+		t.Fatalf("GetUnconfirmedAccountMetaFresh: %v", err)
+	} else if meta != uAccess.diskMeta {
+		t.Fatalf("expected fallback to the disk meta after commit, got %+v", meta)
+	}
+	if quota := ac.GetAccountQuota(addr, snapshotHash); quota.Cmp(uAccess.diskQuota) != 0 {
+		t.Fatalf("expected fallback to the disk quota (%s) after commit, got %s", uAccess.diskQuota, quota)
+	}
+}
+
+// TestCommitFailureStillPopsLayer guards against a failed disk commit
+// leaving its layer stuck on the Snapshot stack: Depth must return to its
+// pre-failure value, and a later Insert for the same snapshot hash that
+// pushes Depth back past maxDepth must not block forever waiting for a
+// pop that will never come.
+func TestCommitFailureStillPopsLayer(t *testing.T) {
+	access := newFakeAccess()
+	snapshotHash := types.Hash{}
+	failing := blockWithHash(snapshotHash, 1)
+	wantErr := errors.New("disk full")
+	access.failCommit[failing.Hash] = wantErr
+
+	ac := newTestAccountChain(access, fakeValidator{}, 1)
+	defer ac.Stop()
+
+	layer, err := ac.pipeline.Insert(failing)
+	if err != nil {
+		t.Fatalf("Insert should only report validate/mutate errors, got %v", err)
+	}
+	if err := layer.Wait(); err != wantErr {
+		t.Fatalf("expected commit error via Wait, got %v", err)
+	}
+
+	deadline := time.After(time.Second)
+	for ac.snapshot.Depth(snapshotHash) != 0 {
+		select {
+		case <-deadline:
+			t.Fatalf("Depth never returned to 0 after a failed commit, got %d", ac.snapshot.Depth(snapshotHash))
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ac.pipeline.Insert(blockWithHash(snapshotHash, 2))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Insert after failed commit: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Insert blocked: a failed commit left the snapshot stack wedged above maxDepth")
+	}
+}
+
+func TestInsertCommitsInQueueOrderDespiteOverflow(t *testing.T) {
+	access := newFakeAccess()
+	access.commitDelay = 5 * time.Millisecond
+
+	// A maxLayerDepth of 1 guarantees every block after the first triggers
+	// the overflow wait path, which used to commit the triggering layer
+	// out of turn ahead of older, still-queued layers.
+	ac := newTestAccountChain(access, fakeValidator{}, 1)
+	defer ac.Stop()
+
+	snapshotHash := types.Hash{}
+	const n = 6
+	var want []types.Hash
+	for i := byte(1); i <= n; i++ {
+		block := blockWithHash(snapshotHash, i)
+		want = append(want, block.Hash)
+		if _, err := ac.pipeline.Insert(block); err != nil {
+			t.Fatalf("Insert(%d): %v", i, err)
+		}
+	}
+
+	ac.Stop()
+	got := access.orderedHashes()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d commits, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("commit order mismatch at %d: want %v, got %v", i, want, got)
+		}
+	}
+}
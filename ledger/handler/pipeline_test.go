@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/vitelabs/go-vite/common/types"
+	"github.com/vitelabs/go-vite/ledger"
+)
+
+func TestSnapshotPushPopLatest(t *testing.T) {
+	snapshot := NewSnapshot(2)
+
+	var snapshotHash types.Hash
+	var addr types.Address
+
+	layer1 := &DiffLayer{SnapshotHash: snapshotHash, Block: &ledger.AccountBlock{AccountAddress: addr}}
+	layer2 := &DiffLayer{SnapshotHash: snapshotHash, Block: &ledger.AccountBlock{AccountAddress: addr}}
+
+	if overflow := snapshot.Push(layer1); overflow {
+		t.Fatalf("did not expect overflow after first push")
+	}
+	if got := snapshot.Latest(snapshotHash, addr); got != layer1 {
+		t.Fatalf("expected Latest to return layer1")
+	}
+
+	overflow := snapshot.Push(layer2)
+	if got := snapshot.Latest(snapshotHash, addr); got != layer2 {
+		t.Fatalf("expected Latest to return the most recently pushed layer")
+	}
+	if snapshot.Depth(snapshotHash) != 2 {
+		t.Fatalf("expected depth 2, got %d", snapshot.Depth(snapshotHash))
+	}
+	_ = overflow
+
+	snapshot.Pop(layer1)
+	if snapshot.Depth(snapshotHash) != 1 {
+		t.Fatalf("expected depth 1 after popping layer1, got %d", snapshot.Depth(snapshotHash))
+	}
+
+	snapshot.Pop(layer2)
+	if snapshot.Depth(snapshotHash) != 0 {
+		t.Fatalf("expected depth 0 after popping all layers, got %d", snapshot.Depth(snapshotHash))
+	}
+	if got := snapshot.Latest(snapshotHash, addr); got != nil {
+		t.Fatalf("expected no layer left after both popped, got %+v", got)
+	}
+}
+
+func TestSnapshotForcesOverflowPastMaxDepth(t *testing.T) {
+	snapshot := NewSnapshot(1)
+	var snapshotHash types.Hash
+
+	if overflow := snapshot.Push(&DiffLayer{SnapshotHash: snapshotHash, Block: &ledger.AccountBlock{}}); overflow {
+		t.Fatalf("did not expect overflow at depth 1 with maxDepth 1")
+	}
+	if overflow := snapshot.Push(&DiffLayer{SnapshotHash: snapshotHash, Block: &ledger.AccountBlock{}}); !overflow {
+		t.Fatalf("expected overflow once depth exceeds maxDepth")
+	}
+}
@@ -0,0 +1,239 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/vitelabs/go-vite/account"
+	"github.com/vitelabs/go-vite/common/rlp"
+	"github.com/vitelabs/go-vite/crypto/ed25519"
+)
+
+var (
+	// ErrAuthenticationFailed is returned by Handshake when the remote
+	// side's signature over the session challenge does not verify.
+	ErrAuthenticationFailed = errors.New("secure: remote signature does not verify")
+
+	// ErrUnauthorized is returned by Handshake when the remote side signs
+	// correctly with an ed25519 key that the authorizer does not accept.
+	ErrUnauthorized = errors.New("secure: remote identity rejected by authorizer")
+)
+
+// Authorizer decides whether a successfully-authenticated remote pubkey is
+// allowed to complete the handshake. It runs after signature verification,
+// so it only has to make a trust decision, not re-validate the proof.
+// Returning a non-nil error aborts the handshake with that error.
+type Authorizer func(remotePubKey []byte) error
+
+// ExpectPubKey returns an Authorizer that only accepts the given pubkey,
+// for dialers that know in advance which node they meant to connect to.
+func ExpectPubKey(expected []byte) Authorizer {
+	return func(remotePubKey []byte) error {
+		if !bytes.Equal(remotePubKey, expected) {
+			return ErrUnauthorized
+		}
+		return nil
+	}
+}
+
+// AcceptAny is an Authorizer that trusts any identity that passes signature
+// verification, for listeners that don't yet know who will dial in.
+func AcceptAny(remotePubKey []byte) error {
+	return nil
+}
+
+// authMessage is exchanged, already encrypted, once the ephemeral DH keys
+// have been mixed: it binds the long-term ed25519 identity to this
+// particular ephemeral key exchange.
+type authMessage struct {
+	PubKeyEd25519 []byte
+	Signature     []byte
+}
+
+// Handshake performs a station-to-station handshake over rw and returns an
+// authenticated, encrypted Conn. initiator must be true on exactly one side
+// of the connection (the dialer) so the ephemeral pubkey exchange does not
+// deadlock. authorize is consulted with the remote's verified long-term
+// pubkey before the Conn is handed back; a dialer that knows which node it
+// meant to reach should pass ExpectPubKey(expectedRemote) rather than
+// AcceptAny, otherwise any node holding a valid ed25519 key can substitute
+// its identity on the connection.
+func Handshake(rw io.ReadWriteCloser, identity *account.Key, initiator bool, authorize Authorizer) (*Conn, error) {
+	var locEphPriv [32]byte
+	if _, err := rand.Read(locEphPriv[:]); err != nil {
+		return nil, err
+	}
+	locEphPub, err := curve25519.X25519(locEphPriv[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	remEphPub, err := exchangeEphemeralKeys(rw, locEphPub, initiator)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := curve25519.X25519(locEphPriv[:], remEphPub)
+	if err != nil {
+		return nil, err
+	}
+
+	var locPub, remPub [32]byte
+	copy(locPub[:], locEphPub)
+	copy(remPub[:], remEphPub)
+
+	sendKey, recvKey, sendSeed, recvSeed, err := deriveKeys(shared, locPub, remPub)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &Conn{
+		rw:       rw,
+		sendKey:  sendKey,
+		recvKey:  recvKey,
+		sendSeed: sendSeed,
+		recvSeed: recvSeed,
+	}
+
+	challenge, err := deriveChallenge(shared)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := identity.Sign(challenge)
+	if err != nil {
+		return nil, err
+	}
+	ourPub := (*identity.PrivateKey)[len(*identity.PrivateKey)-ed25519.PublicKeySize:]
+	ourAuth, err := rlp.EncodeToBytes(&authMessage{
+		PubKeyEd25519: ourPub,
+		Signature:     sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var peerAuth *authMessage
+	if initiator {
+		if err := conn.WriteFrame(ourAuth); err != nil {
+			return nil, err
+		}
+		peerAuth, err = readAuth(conn)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		peerAuth, err = readAuth(conn)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.WriteFrame(ourAuth); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(peerAuth.PubKeyEd25519) != ed25519.PublicKeySize {
+		return nil, ErrAuthenticationFailed
+	}
+	if !ed25519.Verify(peerAuth.PubKeyEd25519, challenge, peerAuth.Signature) {
+		return nil, ErrAuthenticationFailed
+	}
+	if authorize == nil {
+		authorize = AcceptAny
+	}
+	if err := authorize(peerAuth.PubKeyEd25519); err != nil {
+		return nil, err
+	}
+	conn.RemotePubKey = peerAuth.PubKeyEd25519
+
+	return conn, nil
+}
+
+func exchangeEphemeralKeys(rw io.ReadWriteCloser, locEphPub []byte, initiator bool) ([]byte, error) {
+	remEphPub := make([]byte, 32)
+	if initiator {
+		if _, err := rw.Write(locEphPub); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(rw, remEphPub); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := io.ReadFull(rw, remEphPub); err != nil {
+			return nil, err
+		}
+		if _, err := rw.Write(locEphPub); err != nil {
+			return nil, err
+		}
+	}
+	return remEphPub, nil
+}
+
+// deriveKeys expands the raw X25519 shared secret into per-direction keys
+// and nonce seeds. The HKDF output is read as lowKey, highKey, lowSeed,
+// highSeed, and the lexicographically lower ephemeral pubkey always takes
+// lowKey and lowSeed, so both sides agree on which key is "send" and which
+// is "recv" without any extra negotiation.
+func deriveKeys(shared []byte, locPub, remPub [32]byte) (sendKey, recvKey [32]byte, sendSeed, recvSeed [24]byte, err error) {
+	var low, high [32]byte
+	locIsLow := bytes.Compare(locPub[:], remPub[:]) < 0
+	if locIsLow {
+		low, high = locPub, remPub
+	} else {
+		low, high = remPub, locPub
+	}
+
+	info := append(append([]byte{}, low[:]...), high[:]...)
+	r := hkdf.New(sha256.New, shared, nil, info)
+
+	var lowKey, highKey [32]byte
+	var lowSeed, highSeed [24]byte
+	if _, err = io.ReadFull(r, lowKey[:]); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(r, highKey[:]); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(r, lowSeed[:]); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(r, highSeed[:]); err != nil {
+		return
+	}
+
+	if locIsLow {
+		sendKey, recvKey = lowKey, highKey
+		sendSeed, recvSeed = lowSeed, highSeed
+	} else {
+		sendKey, recvKey = highKey, lowKey
+		sendSeed, recvSeed = highSeed, lowSeed
+	}
+	return
+}
+
+func deriveChallenge(shared []byte) ([]byte, error) {
+	r := hkdf.New(sha256.New, shared, nil, []byte("challenge"))
+	challenge := make([]byte, 32)
+	if _, err := io.ReadFull(r, challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+func readAuth(conn *Conn) (*authMessage, error) {
+	frame, err := conn.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	msg := new(authMessage)
+	if err := rlp.DecodeBytes(frame, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
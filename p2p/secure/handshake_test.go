@@ -0,0 +1,300 @@
+package secure
+
+import (
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+
+	"github.com/vitelabs/go-vite/account"
+	"github.com/vitelabs/go-vite/common/rlp"
+	"github.com/vitelabs/go-vite/crypto/ed25519"
+)
+
+func newTestIdentity(t *testing.T) (*account.Key, []byte) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return &account.Key{PrivateKey: &priv}, pub
+}
+
+func TestHandshakeMutualAuthentication(t *testing.T) {
+	idA, pubA := newTestIdentity(t)
+	idB, pubB := newTestIdentity(t)
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	type result struct {
+		conn *Conn
+		err  error
+	}
+	doneA := make(chan result, 1)
+	doneB := make(chan result, 1)
+
+	go func() {
+		conn, err := Handshake(a, idA, true, AcceptAny)
+		doneA <- result{conn, err}
+	}()
+	go func() {
+		conn, err := Handshake(b, idB, false, AcceptAny)
+		doneB <- result{conn, err}
+	}()
+
+	resA := <-doneA
+	resB := <-doneB
+	if resA.err != nil {
+		t.Fatalf("initiator handshake: %v", resA.err)
+	}
+	if resB.err != nil {
+		t.Fatalf("responder handshake: %v", resB.err)
+	}
+
+	if string(resA.conn.RemotePubKey) != string(pubB) {
+		t.Fatalf("initiator did not authenticate responder's pubkey")
+	}
+	if string(resB.conn.RemotePubKey) != string(pubA) {
+		t.Fatalf("responder did not authenticate initiator's pubkey")
+	}
+
+	msg := []byte("post-handshake frame")
+	writeDone := make(chan error, 1)
+	go func() { writeDone <- resA.conn.WriteFrame(msg) }()
+	got, err := resB.conn.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if err := <-writeDone; err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if string(got) != string(msg) {
+		t.Fatalf("frame mismatch: got %q, want %q", got, msg)
+	}
+}
+
+func TestHandshakeRejectsUnexpectedPubKey(t *testing.T) {
+	idA, _ := newTestIdentity(t)
+	idB, pubB := newTestIdentity(t)
+	wrongPub := make([]byte, len(pubB))
+	copy(wrongPub, pubB)
+	wrongPub[0] ^= 0xff
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	doneA := make(chan error, 1)
+	go func() {
+		_, err := Handshake(a, idA, true, ExpectPubKey(wrongPub))
+		doneA <- err
+	}()
+	go Handshake(b, idB, false, AcceptAny)
+
+	if err := <-doneA; err != ErrUnauthorized {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+// TestHandshakeRejectsForgedSignature plays the B side of the protocol by
+// hand, signing the challenge with a key that does not match the
+// PubKeyEd25519 it advertises, and asserts the genuine A side refuses it.
+func TestHandshakeRejectsForgedSignature(t *testing.T) {
+	idA, _ := newTestIdentity(t)
+	_, forgedPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	claimedPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	doneA := make(chan error, 1)
+	go func() {
+		_, err := Handshake(a, idA, true, AcceptAny)
+		doneA <- err
+	}()
+
+	var locEphPriv [32]byte
+	rand.Read(locEphPriv[:])
+	locEphPub, err := curve25519.X25519(locEphPriv[:], curve25519.Basepoint)
+	if err != nil {
+		t.Fatalf("X25519: %v", err)
+	}
+	remEphPub, err := exchangeEphemeralKeys(b, locEphPub, false)
+	if err != nil {
+		t.Fatalf("exchangeEphemeralKeys: %v", err)
+	}
+	shared, err := curve25519.X25519(locEphPriv[:], remEphPub)
+	if err != nil {
+		t.Fatalf("X25519 shared: %v", err)
+	}
+	var locPub, remPub [32]byte
+	copy(locPub[:], locEphPub)
+	copy(remPub[:], remEphPub)
+	sendKey, recvKey, sendSeed, recvSeed, err := deriveKeys(shared, locPub, remPub)
+	if err != nil {
+		t.Fatalf("deriveKeys: %v", err)
+	}
+	conn := &Conn{rw: b, sendKey: sendKey, recvKey: recvKey, sendSeed: sendSeed, recvSeed: recvSeed}
+
+	challenge, err := deriveChallenge(shared)
+	if err != nil {
+		t.Fatalf("deriveChallenge: %v", err)
+	}
+	// Sign with a key unrelated to claimedPub, so the signature cannot
+	// verify against the pubkey we advertise.
+	forgedSig := ed25519.Sign(forgedPriv, challenge)
+	authBytes, err := rlp.EncodeToBytes(&authMessage{PubKeyEd25519: claimedPub, Signature: forgedSig})
+	if err != nil {
+		t.Fatalf("rlp.EncodeToBytes: %v", err)
+	}
+
+	peerAuth, err := readAuth(conn)
+	if err != nil {
+		t.Fatalf("readAuth: %v", err)
+	}
+	_ = peerAuth
+	if err := conn.WriteFrame(authBytes); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+
+	if err := <-doneA; err != ErrAuthenticationFailed {
+		t.Fatalf("expected ErrAuthenticationFailed, got %v", err)
+	}
+}
+
+// TestHandshakeRejectsMalformedPubKeyLength plays the B side of the
+// protocol by hand, advertising a PubKeyEd25519 that is not exactly
+// ed25519.PublicKeySize bytes, and asserts the genuine A side rejects it
+// without panicking.
+func TestHandshakeRejectsMalformedPubKeyLength(t *testing.T) {
+	idA, _ := newTestIdentity(t)
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	doneA := make(chan error, 1)
+	go func() {
+		_, err := Handshake(a, idA, true, AcceptAny)
+		doneA <- err
+	}()
+
+	var locEphPriv [32]byte
+	rand.Read(locEphPriv[:])
+	locEphPub, err := curve25519.X25519(locEphPriv[:], curve25519.Basepoint)
+	if err != nil {
+		t.Fatalf("X25519: %v", err)
+	}
+	remEphPub, err := exchangeEphemeralKeys(b, locEphPub, false)
+	if err != nil {
+		t.Fatalf("exchangeEphemeralKeys: %v", err)
+	}
+	shared, err := curve25519.X25519(locEphPriv[:], remEphPub)
+	if err != nil {
+		t.Fatalf("X25519 shared: %v", err)
+	}
+	var locPub, remPub [32]byte
+	copy(locPub[:], locEphPub)
+	copy(remPub[:], remEphPub)
+	sendKey, recvKey, sendSeed, recvSeed, err := deriveKeys(shared, locPub, remPub)
+	if err != nil {
+		t.Fatalf("deriveKeys: %v", err)
+	}
+	conn := &Conn{rw: b, sendKey: sendKey, recvKey: recvKey, sendSeed: sendSeed, recvSeed: recvSeed}
+
+	challenge, err := deriveChallenge(shared)
+	if err != nil {
+		t.Fatalf("deriveChallenge: %v", err)
+	}
+	// Short pubkey: must be rejected by a length check before it ever
+	// reaches ed25519.Verify, which panics on wrong-sized keys.
+	shortPub := make([]byte, ed25519.PublicKeySize-1)
+	rand.Read(shortPub)
+	sig := ed25519.Sign(func() ed25519.PrivateKey {
+		_, priv, _ := ed25519.GenerateKey(rand.Reader)
+		return priv
+	}(), challenge)
+	authBytes, err := rlp.EncodeToBytes(&authMessage{PubKeyEd25519: shortPub, Signature: sig})
+	if err != nil {
+		t.Fatalf("rlp.EncodeToBytes: %v", err)
+	}
+
+	peerAuth, err := readAuth(conn)
+	if err != nil {
+		t.Fatalf("readAuth: %v", err)
+	}
+	_ = peerAuth
+	if err := conn.WriteFrame(authBytes); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+
+	if err := <-doneA; err != ErrAuthenticationFailed {
+		t.Fatalf("expected ErrAuthenticationFailed, got %v", err)
+	}
+}
+
+func TestDeriveKeysAreSymmetric(t *testing.T) {
+	var privA, privB [32]byte
+	rand.Read(privA[:])
+	rand.Read(privB[:])
+
+	pubA, err := curve25519.X25519(privA[:], curve25519.Basepoint)
+	if err != nil {
+		t.Fatalf("X25519: %v", err)
+	}
+	pubB, err := curve25519.X25519(privB[:], curve25519.Basepoint)
+	if err != nil {
+		t.Fatalf("X25519: %v", err)
+	}
+
+	sharedA, err := curve25519.X25519(privA[:], pubB)
+	if err != nil {
+		t.Fatalf("shared A: %v", err)
+	}
+	sharedB, err := curve25519.X25519(privB[:], pubA)
+	if err != nil {
+		t.Fatalf("shared B: %v", err)
+	}
+
+	var a, b [32]byte
+	copy(a[:], pubA)
+	copy(b[:], pubB)
+
+	sendA, recvA, sendSeedA, recvSeedA, err := deriveKeys(sharedA, a, b)
+	if err != nil {
+		t.Fatalf("deriveKeys A: %v", err)
+	}
+	sendB, recvB, sendSeedB, recvSeedB, err := deriveKeys(sharedB, b, a)
+	if err != nil {
+		t.Fatalf("deriveKeys B: %v", err)
+	}
+
+	if sendA != recvB || recvA != sendB {
+		t.Fatalf("send/recv keys are not swapped between peers")
+	}
+	if sendSeedA != recvSeedB || recvSeedA != sendSeedB {
+		t.Fatalf("send/recv nonce seeds are not swapped between peers")
+	}
+}
+
+func TestDeriveChallengeDeterministic(t *testing.T) {
+	shared := []byte("some shared secret material")
+	c1, err := deriveChallenge(shared)
+	if err != nil {
+		t.Fatalf("deriveChallenge: %v", err)
+	}
+	c2, _ := deriveChallenge(shared)
+	if string(c1) != string(c2) {
+		t.Fatalf("deriveChallenge is not deterministic")
+	}
+}
@@ -0,0 +1,118 @@
+// Package secure wraps a raw peer connection with an authenticated,
+// encrypted transport. The handshake (see handshake.go) is a
+// station-to-station exchange over X25519 + ed25519; the resulting
+// per-direction keys are used here to seal every frame with
+// nacl/secretbox.
+package secure
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	// maxFramePayload is the largest plaintext payload a single frame may
+	// carry. The 4-byte length prefix lives inside the sealed box so that
+	// every frame on the wire is exactly maxFramePayload+4+secretbox.Overhead
+	// bytes long, regardless of how much real data it carries.
+	maxFramePayload = 1024 - 4
+
+	plainFrameSize = 4 + maxFramePayload
+	wireFrameSize  = plainFrameSize + secretbox.Overhead
+)
+
+var (
+	// ErrFrameTooLarge is returned by WriteFrame when data exceeds maxFramePayload.
+	ErrFrameTooLarge = errors.New("secure: frame payload exceeds maximum size")
+	// ErrAuthFailed is returned by ReadFrame when a frame fails to authenticate.
+	ErrAuthFailed = errors.New("secure: frame authentication failed")
+)
+
+// Conn is an authenticated, encrypted io.ReadWriteCloser built on top of an
+// underlying transport after a successful Handshake.
+type Conn struct {
+	rw io.ReadWriteCloser
+
+	sendKey [32]byte
+	recvKey [32]byte
+
+	sendSeed [24]byte
+	recvSeed [24]byte
+
+	sendCounter uint64
+	recvCounter uint64
+
+	writeMu sync.Mutex
+	readMu  sync.Mutex
+
+	// RemotePubKey is the long-term ed25519 public key the remote side
+	// authenticated with during the handshake.
+	RemotePubKey []byte
+}
+
+func nonceFor(seed [24]byte, counter uint64) [24]byte {
+	nonce := seed
+	binary.BigEndian.PutUint64(nonce[16:24], counter)
+	return nonce
+}
+
+// WriteFrame seals and writes a single message. Messages larger than
+// maxFramePayload must be split by the caller.
+func (c *Conn) WriteFrame(data []byte) error {
+	if len(data) > maxFramePayload {
+		return ErrFrameTooLarge
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	var plain [plainFrameSize]byte
+	binary.BigEndian.PutUint32(plain[0:4], uint32(len(data)))
+	copy(plain[4:], data)
+
+	nonce := nonceFor(c.sendSeed, c.sendCounter)
+	c.sendCounter++
+
+	sealed := secretbox.Seal(nil, plain[:], &nonce, &c.sendKey)
+	if len(sealed) != wireFrameSize {
+		return errors.New("secure: unexpected sealed frame size")
+	}
+	_, err := c.rw.Write(sealed)
+	return err
+}
+
+// ReadFrame reads and opens a single message written by WriteFrame.
+func (c *Conn) ReadFrame() ([]byte, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	sealed := make([]byte, wireFrameSize)
+	if _, err := io.ReadFull(c.rw, sealed); err != nil {
+		return nil, err
+	}
+
+	nonce := nonceFor(c.recvSeed, c.recvCounter)
+	c.recvCounter++
+
+	plain, ok := secretbox.Open(nil, sealed, &nonce, &c.recvKey)
+	if !ok {
+		return nil, ErrAuthFailed
+	}
+
+	length := binary.BigEndian.Uint32(plain[0:4])
+	if length > maxFramePayload {
+		return nil, ErrAuthFailed
+	}
+	out := make([]byte, length)
+	copy(out, plain[4:4+length])
+	return out, nil
+}
+
+// Close closes the underlying connection.
+func (c *Conn) Close() error {
+	return c.rw.Close()
+}
@@ -0,0 +1,66 @@
+package secure
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func pairedConns(t *testing.T) (*Conn, *Conn) {
+	t.Helper()
+	a, b := net.Pipe()
+
+	var keyA, keyB [32]byte
+	keyA[0], keyB[0] = 1, 2
+	var seedA, seedB [24]byte
+	seedA[0], seedB[0] = 3, 4
+
+	connA := &Conn{rw: a, sendKey: keyA, recvKey: keyB, sendSeed: seedA, recvSeed: seedB}
+	connB := &Conn{rw: b, sendKey: keyB, recvKey: keyA, sendSeed: seedB, recvSeed: seedA}
+	return connA, connB
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	a, b := pairedConns(t)
+	defer a.Close()
+	defer b.Close()
+
+	msg := []byte("hello secure world")
+	done := make(chan error, 1)
+	go func() { done <- a.WriteFrame(msg) }()
+
+	got, err := b.ReadFrame()
+	if err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("roundtrip mismatch: got %q, want %q", got, msg)
+	}
+}
+
+func TestFrameRejectsOversizedPayload(t *testing.T) {
+	a, b := pairedConns(t)
+	defer a.Close()
+	defer b.Close()
+
+	if err := a.WriteFrame(make([]byte, maxFramePayload+1)); err != ErrFrameTooLarge {
+		t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+	}
+}
+
+func TestFrameTamperDetected(t *testing.T) {
+	a, b := pairedConns(t)
+	defer a.Close()
+	defer b.Close()
+
+	// give the wrong recv key to b so opening the sealed frame must fail.
+	b.recvKey[0] ^= 0xff
+
+	go a.WriteFrame([]byte("tamper me"))
+	if _, err := b.ReadFrame(); err != ErrAuthFailed {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+}
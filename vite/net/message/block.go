@@ -1,22 +1,32 @@
 package message
 
 import (
+	"bytes"
+	"errors"
+
+	"github.com/vitelabs/go-vite/common/rlp"
 	"github.com/vitelabs/go-vite/common/types"
 	"github.com/vitelabs/go-vite/ledger"
 )
 
+// errNonCanonicalSubLedger is returned when decoding a SubLedger whose
+// ABlocks tuples are not in strictly increasing address order, which means
+// it was not produced by SubLedger.Serialize and cannot be trusted to hash
+// the same way twice.
+var errNonCanonicalSubLedger = errors.New("message: sub ledger account blocks are not address-sorted")
+
 type GetSnapshotBlocks struct {
-	From *ledger.HashHeight
-	Count uint64
+	From    *ledger.HashHeight
+	Count   uint64
 	Forward bool
 }
 
 func (b *GetSnapshotBlocks) Serialize() ([]byte, error) {
-	panic("implement me")
+	return rlp.EncodeToBytes(b)
 }
 
 func (b *GetSnapshotBlocks) Deserialize(buf []byte) error {
-	panic("implement me")
+	return rlp.DecodeBytes(buf, b)
 }
 
 type SubLedger struct {
@@ -24,12 +34,54 @@ type SubLedger struct {
 	ABlocks map[types.Address][]*ledger.AccountBlock
 }
 
+// subLedgerAccountBlocks is the wire form of one SubLedger.ABlocks entry.
+// Encoding the map as a list of (address, blocks) tuples in address-sorted
+// order keeps the encoding deterministic and therefore hashable.
+type subLedgerAccountBlocks struct {
+	Address types.Address
+	Blocks  []*ledger.AccountBlock
+}
+
+type subLedgerWire struct {
+	SBlocks []*ledger.SnapshotBlock
+	ABlocks []*subLedgerAccountBlocks
+}
+
 func (s *SubLedger) Serialize() ([]byte, error) {
-	panic("implement me")
+	addrs := make([]types.Address, 0, len(s.ABlocks))
+	for addr := range s.ABlocks {
+		addrs = append(addrs, addr)
+	}
+	sortAddresses(addrs)
+
+	wire := subLedgerWire{
+		SBlocks: s.SBlocks,
+		ABlocks: make([]*subLedgerAccountBlocks, len(addrs)),
+	}
+	for i, addr := range addrs {
+		wire.ABlocks[i] = &subLedgerAccountBlocks{Address: addr, Blocks: s.ABlocks[addr]}
+	}
+	return rlp.EncodeToBytes(&wire)
 }
 
 func (s *SubLedger) Deserialize(buf []byte) error {
-	panic("implement me")
+	wire := new(subLedgerWire)
+	if err := rlp.DecodeBytes(buf, wire); err != nil {
+		return err
+	}
+	s.SBlocks = wire.SBlocks
+	s.ABlocks = make(map[types.Address][]*ledger.AccountBlock, len(wire.ABlocks))
+
+	var prev *types.Address
+	for _, entry := range wire.ABlocks {
+		if prev != nil && bytes.Compare(prev.Bytes(), entry.Address.Bytes()) >= 0 {
+			return errNonCanonicalSubLedger
+		}
+		addr := entry.Address
+		prev = &addr
+		s.ABlocks[entry.Address] = entry.Blocks
+	}
+	return nil
 }
 
 type SnapshotBlocks struct {
@@ -37,37 +89,48 @@ type SnapshotBlocks struct {
 }
 
 func (b *SnapshotBlocks) Serialize() ([]byte, error) {
-	panic("implement me")
+	return rlp.EncodeToBytes(b)
 }
 
 func (b *SnapshotBlocks) Deserialize(buf []byte) error {
-	panic("implement me")
+	return rlp.DecodeBytes(buf, b)
 }
 
 type GetAccountBlocks struct {
 	Address types.Address
-	From *ledger.HashHeight
-	Count uint64
+	From    *ledger.HashHeight
+	Count   uint64
 	Forward bool
 }
 
 func (b *GetAccountBlocks) Serialize() ([]byte, error) {
-	panic("implement me")
+	return rlp.EncodeToBytes(b)
 }
 
 func (b *GetAccountBlocks) Deserialize(buf []byte) error {
-	panic("implement me")
+	return rlp.DecodeBytes(buf, b)
 }
 
 type AccountBlocks struct {
 	Address types.Address
-	Blocks []*ledger.AccountBlock
+	Blocks  []*ledger.AccountBlock
 }
 
 func (a *AccountBlocks) Serialize() ([]byte, error) {
-	panic("implement me")
+	return rlp.EncodeToBytes(a)
 }
 
 func (a *AccountBlocks) Deserialize(buf []byte) error {
-	panic("implement me")
-}
\ No newline at end of file
+	return rlp.DecodeBytes(buf, a)
+}
+
+// sortAddresses sorts addresses lexicographically by their raw bytes so
+// repeated serialization of the same SubLedger always produces the same
+// encoding.
+func sortAddresses(addrs []types.Address) {
+	for i := 1; i < len(addrs); i++ {
+		for j := i; j > 0 && bytes.Compare(addrs[j-1].Bytes(), addrs[j].Bytes()) > 0; j-- {
+			addrs[j-1], addrs[j] = addrs[j], addrs[j-1]
+		}
+	}
+}
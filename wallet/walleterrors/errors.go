@@ -0,0 +1,18 @@
+// Package walleterrors holds the sentinel errors the wallet/account layer
+// returns, so callers (and the JSON-RPC error mapping in rpcapi/api) can
+// match on them instead of on error strings.
+package walleterrors
+
+import "errors"
+
+var (
+	// ErrDecryptKey is returned when a keystore file fails to decrypt,
+	// either because the password is wrong or the file is corrupt: the
+	// secretbox MAC check has no way to tell the two apart, so its failure
+	// is the only signal we get.
+	ErrDecryptKey = errors.New("could not decrypt key with given password")
+
+	// ErrAlreadyLocked is returned when an operation requires an unlocked
+	// account but the account is currently locked.
+	ErrAlreadyLocked = errors.New("account already locked")
+)